@@ -66,12 +66,38 @@ type ServiceCache interface {
 	ListServices(ns string) (string, []*model.Service)
 	// ListAllServices get all service and revision
 	ListAllServices() (string, []*model.Service)
+	// ListServicesSince returns services changed/removed in ns (empty ns means all
+	// namespaces) since sinceRevision; resyncRequired is true when sinceRevision has
+	// aged out of the retained history and the caller must fall back to a full snapshot
+	ListServicesSince(ns string, sinceRevision string) (
+		newRevision string, changed []*model.Service, removed []string, resyncRequired bool, err error)
 	// ListServiceAlias list service link alias list
 	ListServiceAlias(namespace, name string) []*model.Service
 	// GetAliasFor get alias reference service info
 	GetAliasFor(name string, namespace string) *model.Service
+	// Subscribe registers a push-based watch for service changes matching filter. The
+	// initial snapshot is taken before this call returns and queued ahead of any later
+	// event; handler.OnBatchSync and the add/update/delete callbacks are all invoked
+	// asynchronously on the subscription's own goroutine, so OnBatchSync may not have
+	// run yet when Subscribe returns.
+	Subscribe(filter SubscribeFilter, handler ServiceEventHandler) (SubscriptionID, error)
+	// Unsubscribe cancels a subscription previously created by Subscribe
+	Unsubscribe(id SubscriptionID)
+	// GetTombstone returns the tombstone left by a recently deleted service, or nil if
+	// no delete was seen for id or its tombstone was already removed by the periodic GC
+	// (tombstones older than the TTL stay visible until the next GC sweep)
+	GetTombstone(id string) *Tombstone
+	// ListRecentlyDeleted returns the tombstones of services deleted since the given time
+	ListRecentlyDeleted(since time.Time) []*Tombstone
+	// SelectServices queries services by a Kubernetes-style metadata selector, optionally
+	// scoped to a set of namespaces, using the indexed fast path when available
+	SelectServices(sel MetaSelector, opts SelectOpts) []*model.Service
 	// Update Query trigger update interface
 	Update() error
+	// Close stops the disk snapshot writer started when opt["cacheDir"] is set; the
+	// tombstone GC goroutine started by initialize is not stopped. Safe to call even
+	// when no snapshot writer was started, and safe to call more than once
+	Close() error
 }
 
 // serviceCache Service data cache implementation class
@@ -106,6 +132,24 @@ type serviceCache struct {
 
 	serviceCount     int64
 	lastCheckAllTime int64
+
+	// subscriptionID -> *serviceSubscription
+	subscribers *utils.SyncMap[SubscriptionID, *serviceSubscription]
+
+	// persistence 磁盘快照管理器，未配置 cacheDir 时为 nil
+	persistence    *servicePersistence
+	snapshotMaxAge time.Duration
+
+	// service_id -> *Tombstone，记录最近删除的服务，用于修复删除与实例计数重载之间的竞态
+	tombstones   *utils.SyncMap[string, *Tombstone]
+	tombstoneTTL time.Duration
+
+	// metaIndex 基于 opt["indexedMetaKeys"] 声明的 key 维护的元数据倒排索引
+	metaIndex *serviceMetaIndex
+
+	// revisionRings 按命名空间（以及 allNamespacesRingKey 代表的全量）维护的版本变更环形缓冲区
+	revisionRings    *utils.SyncMap[string, *namespaceRevisionRing]
+	revisionRingSize int
 }
 
 // init 自注册到缓存列表
@@ -134,12 +178,39 @@ func (sc *serviceCache) initialize(opt map[string]interface{}) error {
 	sc.cl5Names = utils.NewSyncMap[string, *model.Service]()
 	sc.pendingServices = utils.NewSyncMap[string, struct{}]()
 	sc.namespaceServiceCnt = utils.NewSyncMap[string, *model.NamespaceServiceCount]()
-	if opt == nil {
-		return nil
+	sc.subscribers = utils.NewSyncMap[SubscriptionID, *serviceSubscription]()
+	sc.tombstones = utils.NewSyncMap[string, *Tombstone]()
+	sc.tombstoneTTL = defaultTombstoneTTL
+	sc.metaIndex = newServiceMetaIndex(nil)
+	sc.revisionRings = utils.NewSyncMap[string, *namespaceRevisionRing]()
+	sc.revisionRingSize = defaultRevisionRingSize
+
+	if opt != nil {
+		sc.disableBusiness, _ = opt["disableBusiness"].(bool)
+		sc.needMeta, _ = opt["needMeta"].(bool)
+
+		if cacheDir, _ := opt["cacheDir"].(string); cacheDir != "" {
+			sc.persistence = newServicePersistence(cacheDir)
+			sc.snapshotMaxAge = 5 * time.Minute
+			if maxAge, ok := opt["cacheMaxAge"].(time.Duration); ok && maxAge > 0 {
+				sc.snapshotMaxAge = maxAge
+			}
+		}
+		if ttl, ok := opt["tombstoneTTL"].(time.Duration); ok && ttl > 0 {
+			sc.tombstoneTTL = ttl
+		}
+		if indexedMetaKeys, ok := opt["indexedMetaKeys"].([]string); ok {
+			sc.metaIndex = newServiceMetaIndex(indexedMetaKeys)
+		}
+		if ringSize, ok := opt["revisionRingSize"].(int); ok && ringSize > 0 {
+			sc.revisionRingSize = ringSize
+		}
 	}
 
-	sc.disableBusiness, _ = opt["disableBusiness"].(bool)
-	sc.needMeta, _ = opt["needMeta"].(bool)
+	// Start the tombstone GC loop only after every opt[...] override (in particular
+	// tombstoneTTL) has been applied, so gcTombstones never reads sc.tombstoneTTL
+	// concurrently with this function still writing it.
+	go sc.gcTombstones()
 	return nil
 }
 
@@ -185,9 +256,19 @@ func (sc *serviceCache) checkAll() {
 }
 
 func (sc *serviceCache) realUpdate() (map[string]time.Time, int64, error) {
+	firstUpdate := sc.isFirstUpdate()
+	if firstUpdate && sc.persistence != nil {
+		snapshot, err := sc.persistence.load(sc.snapshotMaxAge)
+		if err != nil {
+			log.Errorf("[Cache][Service] load cache snapshot err: %s", err.Error())
+		} else if snapshot != nil {
+			sc.hydrateFromSnapshot(snapshot)
+		}
+	}
+
 	// 获取几秒前的全部数据
 	start := time.Now()
-	services, err := sc.storage.GetMoreServices(sc.LastFetchTime(), sc.isFirstUpdate(), sc.disableBusiness, sc.needMeta)
+	services, err := sc.storage.GetMoreServices(sc.LastFetchTime(), firstUpdate, sc.disableBusiness, sc.needMeta)
 	if err != nil {
 		log.Errorf("[Cache][Service] update services err: %s", err.Error())
 		return nil, -1, err
@@ -197,6 +278,9 @@ func (sc *serviceCache) realUpdate() (map[string]time.Time, int64, error) {
 	costTime := time.Since(start)
 	log.Info("[Cache][Service] get more services", zap.Int("update", update), zap.Int("delete", del),
 		zap.Time("last", sc.LastMtime()), zap.Duration("used", costTime))
+	if (update > 0 || del > 0) && sc.persistence != nil {
+		sc.persistence.schedule(sc.buildSnapshot())
+	}
 	return lastMtimes, int64(len(services)), err
 }
 
@@ -209,6 +293,13 @@ func (sc *serviceCache) clear() error {
 	sc.cl5Names = utils.NewSyncMap[string, *model.Service]()
 	sc.pendingServices = utils.NewSyncMap[string, struct{}]()
 	sc.namespaceServiceCnt = utils.NewSyncMap[string, *model.NamespaceServiceCount]()
+	sc.tombstones = utils.NewSyncMap[string, *Tombstone]()
+	sc.revisionRings = utils.NewSyncMap[string, *namespaceRevisionRing]()
+	if sc.metaIndex != nil {
+		sc.metaIndex.reset()
+	} else {
+		sc.metaIndex = newServiceMetaIndex(nil)
+	}
 	sc.alias = newServiceAliasBucket()
 	sc.serviceList = newServiceNamespaceBucket()
 	return nil
@@ -219,6 +310,12 @@ func (sc *serviceCache) name() string {
 	return ServiceName
 }
 
+// Close 停止磁盘快照写入 goroutine，在服务关闭时调用；initialize 启动的墓碑 GC goroutine 不会被停止
+func (sc *serviceCache) Close() error {
+	sc.persistence.Close()
+	return nil
+}
+
 func (sc *serviceCache) GetAliasFor(name string, namespace string) *model.Service {
 	svc := sc.GetServiceByName(name, namespace)
 	if svc == nil {
@@ -382,8 +479,12 @@ func (sc *serviceCache) GetServiceByCl5Name(cl5Name string) *model.Service {
 
 // removeServices Delete the service data from the cache
 func (sc *serviceCache) removeServices(service *model.Service) {
+	// 先落一条墓碑记录，确保 appendServiceCountChangeNamespace 在索引被清空之后仍然能
+	// 找到该服务归属的命名空间
+	sc.addTombstone(service)
 	// Delete the index of serviceid
 	sc.ids.Delete(service.ID)
+	sc.metaIndex.removeService(service)
 	// delete service item from name list
 	sc.serviceList.removeService(service)
 	// delete service all link alias info
@@ -423,6 +524,16 @@ func (sc *serviceCache) setServices(services map[string]*model.Service) (map[str
 	svcCount := sc.serviceCount
 
 	aliases := make([]*model.Service, 0, 32)
+	// 按命名空间记录本次的增删 serviceID，供 ListServicesSince 的版本环形缓冲区使用
+	nsDeltas := make(map[string]*revisionDelta)
+	deltaFor := func(ns string) *revisionDelta {
+		d, ok := nsDeltas[ns]
+		if !ok {
+			d = &revisionDelta{}
+			nsDeltas[ns] = d
+		}
+		return d
+	}
 
 	for _, service := range services {
 		progress++
@@ -445,20 +556,30 @@ func (sc *serviceCache) setServices(services map[string]*model.Service) (map[str
 		if !service.Valid {
 			sc.removeServices(service)
 			sc.revisionCh <- newRevisionNotify(service.ID, false)
+			sc.dispatchServiceEvent(eventServiceDeleted, service)
+			d := deltaFor(spaceName)
+			d.removed = append(d.removed, service.ID)
 			del++
 			svcCount--
 			continue
 		}
 
 		update++
-		_, exist := sc.ids.Load(service.ID)
+		prev, exist := sc.ids.Load(service.ID)
 		if !exist {
 			svcCount++
 		}
 
 		sc.ids.Store(service.ID, service)
+		sc.metaIndex.update(prev, service)
 		sc.serviceList.addService(service)
 		sc.revisionCh <- newRevisionNotify(service.ID, true)
+		if exist {
+			sc.dispatchServiceEvent(eventServiceUpdated, service)
+		} else {
+			sc.dispatchServiceEvent(eventServiceAdded, service)
+		}
+		deltaFor(spaceName).changed = append(deltaFor(spaceName).changed, service.ID)
 
 		spaces, ok := sc.names.Load(spaceName)
 		if !ok {
@@ -481,6 +602,7 @@ func (sc *serviceCache) setServices(services map[string]*model.Service) (map[str
 	sc.postProcessServiceAlias(aliases)
 	sc.postProcessUpdatedServices(changeNs)
 	sc.serviceList.reloadRevision()
+	sc.recordRevisionSegments(nsDeltas)
 	return map[string]time.Time{
 		sc.name(): time.Unix(lastMtime, 0),
 	}, update, del
@@ -520,11 +642,17 @@ func (sc *serviceCache) appendServiceCountChangeNamespace(changeNs map[string]st
 	waitDel := map[string]struct{}{}
 	sc.pendingServices.Range(func(svcId string, _ struct{}) bool {
 		svc, ok := sc.ids.Load(svcId)
-		if !ok {
+		if ok {
+			changeNs[svc.Namespace] = struct{}{}
+			waitDel[svcId] = struct{}{}
 			return true
 		}
-		changeNs[svc.Namespace] = struct{}{}
-		waitDel[svcId] = struct{}{}
+		// 服务已经被删除，但墓碑还在保留期内：仍然按照墓碑记录的命名空间归还这次
+		// 实例计数重载，避免该命名空间的统计发生漂移
+		if tomb := sc.GetTombstone(svcId); tomb != nil {
+			changeNs[tomb.Namespace] = struct{}{}
+			waitDel[svcId] = struct{}{}
+		}
 		return true
 	})
 	for svcId := range waitDel {
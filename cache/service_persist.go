@@ -0,0 +1,326 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/polarismesh/polaris/common/model"
+	"github.com/polarismesh/polaris/common/utils"
+)
+
+// serviceCacheSnapshotVersion 快照文件格式版本，格式变更时需要递增，避免加载到旧版本的脏数据
+const serviceCacheSnapshotVersion = 1
+
+// serviceCacheSnapshotFile 快照文件名，固定落在 cacheDir 目录下
+const serviceCacheSnapshotFile = "service_cache.snapshot"
+
+// cl5SidNamePair Cl5Sid2Name 的一条记录，用切片承载而不是 map，保证编码结果确定
+type cl5SidNamePair struct {
+	Sid  string
+	Name string
+}
+
+// cl5NamePair Cl5Names 的一条记录
+type cl5NamePair struct {
+	Name string
+	Svc  *model.Service
+}
+
+// namespaceCountPair NamespaceServiceCnt 的一条记录
+type namespaceCountPair struct {
+	Namespace string
+	Count     *model.NamespaceServiceCount
+}
+
+// serviceCacheSnapshot 落盘的快照内容，字段均为可导出字段，供 gob 序列化。
+//
+// 所有 map 都以按 key 排序后的切片形式存放：gob 编码 map 时内部按随机的哈希桶顺序遍历，
+// 同一份数据两次 Encode 产出的字节不一致，导致 write() 里"先编码一次算 checksum、再编码
+// 一次落盘"的写法和 load() 里"解码后重新编码校验 checksum"的写法都会在有超过一个元素时必然
+// 校验失败。切片的编码顺序完全由内容决定，不存在这个问题。
+//
+// Names and the alias bucket are intentionally not persisted directly: both are
+// deterministically rebuilt from Ids on hydrate, the same way setServices already does.
+type serviceCacheSnapshot struct {
+	Version             int
+	Checksum            [32]byte
+	LastMtime           int64
+	ServiceCount        int64
+	Ids                 []*model.Service
+	Cl5Sid2Name         []cl5SidNamePair
+	Cl5Names            []cl5NamePair
+	NamespaceServiceCnt []namespaceCountPair
+}
+
+// servicePersistence 负责 serviceCache 的磁盘快照读写，写入在独立 goroutine 内完成合并，不占用更新主流程
+type servicePersistence struct {
+	cacheDir string
+
+	triggerCh chan struct{}
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	doneCh    chan struct{}
+
+	pending   *serviceCacheSnapshot
+	pendingMu sync.Mutex
+}
+
+// newServicePersistence 构造磁盘快照管理器，cacheDir 为空时表示不开启落盘
+func newServicePersistence(cacheDir string) *servicePersistence {
+	if cacheDir == "" {
+		return nil
+	}
+	sp := &servicePersistence{
+		cacheDir:  cacheDir,
+		triggerCh: make(chan struct{}, 1),
+		closeCh:   make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	go sp.run()
+	return sp
+}
+
+// Close 停止后台写盘 goroutine，等待其退出后返回；由 serviceCache.Close() 在系统关闭时调用
+func (sp *servicePersistence) Close() {
+	if sp == nil {
+		return
+	}
+	sp.closeOnce.Do(func() {
+		close(sp.closeCh)
+	})
+	<-sp.doneCh
+}
+
+// snapshotPath 快照文件的完整路径
+func (sp *servicePersistence) snapshotPath() string {
+	return filepath.Join(sp.cacheDir, serviceCacheSnapshotFile)
+}
+
+// schedule 提交一份待落盘的快照，短时间内多次调用会被合并为最后一份，避免频繁更新时抖动磁盘
+func (sp *servicePersistence) schedule(snapshot *serviceCacheSnapshot) {
+	if sp == nil {
+		return
+	}
+	sp.pendingMu.Lock()
+	sp.pending = snapshot
+	sp.pendingMu.Unlock()
+
+	select {
+	case sp.triggerCh <- struct{}{}:
+	default:
+	}
+}
+
+// run 后台写盘循环，将 schedule 合并后的最新快照落盘
+func (sp *servicePersistence) run() {
+	defer close(sp.doneCh)
+	for {
+		select {
+		case <-sp.closeCh:
+			return
+		case <-sp.triggerCh:
+		}
+
+		sp.pendingMu.Lock()
+		snapshot := sp.pending
+		sp.pending = nil
+		sp.pendingMu.Unlock()
+
+		if snapshot == nil {
+			continue
+		}
+		if err := sp.write(snapshot); err != nil {
+			log.Errorf("[Cache][Service] persist cache snapshot err: %s", err.Error())
+		}
+	}
+}
+
+// checksum 对快照做确定性编码后取 sha256；调用前 Checksum 字段必须已清零
+func checksumSnapshot(snapshot *serviceCacheSnapshot) ([32]byte, []byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snapshot); err != nil {
+		return [32]byte{}, nil, err
+	}
+	return sha256.Sum256(buf.Bytes()), buf.Bytes(), nil
+}
+
+// write 将快照原子地写入 cacheDir，先写临时文件再 rename，避免进程中途退出产生半截文件
+func (sp *servicePersistence) write(snapshot *serviceCacheSnapshot) error {
+	if err := os.MkdirAll(sp.cacheDir, 0o755); err != nil {
+		return err
+	}
+
+	snapshot.Version = serviceCacheSnapshotVersion
+	snapshot.Checksum = [32]byte{}
+	checksum, _, err := checksumSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	snapshot.Checksum = checksum
+
+	// snapshot now only contains slices (no maps), so this second Encode reproduces
+	// byte-for-byte the same output the checksum above was computed from, modulo the
+	// now-populated Checksum field itself.
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snapshot); err != nil {
+		return err
+	}
+
+	tmpFile := sp.snapshotPath() + fmt.Sprintf(".%d.tmp", time.Now().UnixNano())
+	if err := os.WriteFile(tmpFile, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, sp.snapshotPath())
+}
+
+// load 从磁盘读取快照，maxAge 为 0 表示不校验新鲜度；返回 nil, nil 表示快照不存在或已经失效
+func (sp *servicePersistence) load(maxAge time.Duration) (*serviceCacheSnapshot, error) {
+	if sp == nil {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(sp.snapshotPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshot serviceCacheSnapshot
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot); err != nil {
+		log.Errorf("[Cache][Service] decode cache snapshot err: %s, drop stale snapshot", err.Error())
+		return nil, nil
+	}
+
+	if snapshot.Version != serviceCacheSnapshotVersion {
+		log.Infof("[Cache][Service] cache snapshot version mismatch, expect %d, actual %d, drop",
+			serviceCacheSnapshotVersion, snapshot.Version)
+		return nil, nil
+	}
+
+	wantChecksum := snapshot.Checksum
+	snapshot.Checksum = [32]byte{}
+	gotChecksum, _, err := checksumSnapshot(&snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if gotChecksum != wantChecksum {
+		log.Errorf("[Cache][Service] cache snapshot checksum mismatch, drop stale snapshot")
+		return nil, nil
+	}
+
+	if maxAge > 0 && time.Since(time.Unix(snapshot.LastMtime, 0)) > maxAge {
+		log.Infof("[Cache][Service] cache snapshot is too stale, drop")
+		return nil, nil
+	}
+
+	return &snapshot, nil
+}
+
+// buildSnapshot 从当前内存状态构造一份可落盘的快照，各字段按 key 排序后转换为切片，
+// 保证同一份数据多次编码得到完全一致的字节序列
+func (sc *serviceCache) buildSnapshot() *serviceCacheSnapshot {
+	snapshot := &serviceCacheSnapshot{
+		LastMtime:    sc.LastMtime().Unix(),
+		ServiceCount: sc.serviceCount,
+	}
+
+	sc.ids.Range(func(_ string, svc *model.Service) bool {
+		snapshot.Ids = append(snapshot.Ids, svc)
+		return true
+	})
+	sort.Slice(snapshot.Ids, func(i, j int) bool { return snapshot.Ids[i].ID < snapshot.Ids[j].ID })
+
+	sc.cl5Sid2Name.Range(func(sid string, name string) bool {
+		snapshot.Cl5Sid2Name = append(snapshot.Cl5Sid2Name, cl5SidNamePair{Sid: sid, Name: name})
+		return true
+	})
+	sort.Slice(snapshot.Cl5Sid2Name, func(i, j int) bool {
+		return snapshot.Cl5Sid2Name[i].Sid < snapshot.Cl5Sid2Name[j].Sid
+	})
+
+	sc.cl5Names.Range(func(name string, svc *model.Service) bool {
+		snapshot.Cl5Names = append(snapshot.Cl5Names, cl5NamePair{Name: name, Svc: svc})
+		return true
+	})
+	sort.Slice(snapshot.Cl5Names, func(i, j int) bool { return snapshot.Cl5Names[i].Name < snapshot.Cl5Names[j].Name })
+
+	sc.namespaceServiceCnt.Range(func(ns string, cnt *model.NamespaceServiceCount) bool {
+		snapshot.NamespaceServiceCnt = append(snapshot.NamespaceServiceCnt, namespaceCountPair{Namespace: ns, Count: cnt})
+		return true
+	})
+	sort.Slice(snapshot.NamespaceServiceCnt, func(i, j int) bool {
+		return snapshot.NamespaceServiceCnt[i].Namespace < snapshot.NamespaceServiceCnt[j].Namespace
+	})
+
+	return snapshot
+}
+
+// hydrateFromSnapshot 用磁盘快照恢复内存索引，在首次 update() 真正拉取存储之前执行，
+// 使得冷启动或存储层不可用时读请求也能立刻拿到数据；随后首次 update() 仍以全量方式调用
+// storage.GetMoreServices 做校对，拉取起点不取自快照的 LastMtime
+func (sc *serviceCache) hydrateFromSnapshot(snapshot *serviceCacheSnapshot) {
+	if snapshot == nil {
+		return
+	}
+
+	aliases := make([]*model.Service, 0, 32)
+	for _, svc := range snapshot.Ids {
+		sc.ids.Store(svc.ID, svc)
+
+		spaces, ok := sc.names.Load(svc.Namespace)
+		if !ok {
+			spaces = utils.NewSyncMap[string, *model.Service]()
+			sc.names.Store(svc.Namespace, spaces)
+		}
+		spaces.Store(svc.Name, svc)
+		sc.serviceList.addService(svc)
+		sc.metaIndex.update(nil, svc)
+
+		if svc.IsAlias() {
+			aliases = append(aliases, svc)
+		}
+	}
+	sc.postProcessServiceAlias(aliases)
+	for _, pair := range snapshot.Cl5Sid2Name {
+		sc.cl5Sid2Name.Store(pair.Sid, pair.Name)
+	}
+	for _, pair := range snapshot.Cl5Names {
+		sc.cl5Names.Store(pair.Name, pair.Svc)
+	}
+	for _, pair := range snapshot.NamespaceServiceCnt {
+		sc.namespaceServiceCnt.Store(pair.Namespace, pair.Count)
+	}
+	sc.serviceCount = snapshot.ServiceCount
+	sc.serviceList.reloadRevision()
+
+	// isFirstUpdate() is still true at this point, so the upcoming storage.GetMoreServices
+	// call performs its normal full load and reconciles it against the hydrated state above.
+	log.Infof("[Cache][Service] hydrated %d services from disk snapshot, last mtime %s",
+		len(snapshot.Ids), time.Unix(snapshot.LastMtime, 0))
+}
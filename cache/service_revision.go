@@ -0,0 +1,179 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cache
+
+import (
+	"sync"
+
+	"github.com/polarismesh/polaris/common/model"
+)
+
+// defaultRevisionRingSize 每个命名空间(以及全量)保留的历史版本段数量，可通过
+// opt["revisionRingSize"] 配置
+const defaultRevisionRingSize = 64
+
+// allNamespacesRingKey ListAllServices 对应的 ring 在 revisionRings 里使用的 key，
+// 用一个不可能和真实命名空间重名的前缀来和按命名空间的 ring 区分开
+const allNamespacesRingKey = "\x00__all_namespaces__"
+
+// revisionSegment 一次 setServices 调用在某个命名空间范围内产生的变更集合
+type revisionSegment struct {
+	revision   string
+	changedIDs []string
+	removedIDs []string
+}
+
+// namespaceRevisionRing 某个命名空间（或全量）的版本变更环形缓冲区，按追加顺序保留最近
+// revisionRingSize 次 setServices 调用产生的 delta，支持按 revision 做增量查询
+type namespaceRevisionRing struct {
+	mu       sync.Mutex
+	size     int
+	segments []*revisionSegment
+}
+
+func newNamespaceRevisionRing(size int) *namespaceRevisionRing {
+	return &namespaceRevisionRing{size: size}
+}
+
+// append 追加一个新的版本段，超出 size 时丢弃最旧的段
+func (r *namespaceRevisionRing) append(seg *revisionSegment) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.segments = append(r.segments, seg)
+	if len(r.segments) > r.size {
+		r.segments = r.segments[len(r.segments)-r.size:]
+	}
+}
+
+// since 返回 sinceRevision 之后（不含）累积的 changed/removed 服务ID集合；当 sinceRevision
+// 已经滚出 ring 的保留范围时 found 返回 false，调用方需要走全量快照
+func (r *namespaceRevisionRing) since(sinceRevision string) (changed []string, removed []string, found bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	idx := -1
+	for i, seg := range r.segments {
+		if seg.revision == sinceRevision {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return nil, nil, false
+	}
+
+	changedSet := make(map[string]struct{})
+	removedSet := make(map[string]struct{})
+	for _, seg := range r.segments[idx+1:] {
+		for _, id := range seg.changedIDs {
+			changedSet[id] = struct{}{}
+			delete(removedSet, id)
+		}
+		for _, id := range seg.removedIDs {
+			removedSet[id] = struct{}{}
+			delete(changedSet, id)
+		}
+	}
+	for id := range changedSet {
+		changed = append(changed, id)
+	}
+	for id := range removedSet {
+		removed = append(removed, id)
+	}
+	return changed, removed, true
+}
+
+// revisionDelta 一次 setServices 调用期间按命名空间归类的变更，供 recordRevisionSegments 使用
+type revisionDelta struct {
+	changed []string
+	removed []string
+}
+
+// ringFor 取出（必要时创建）指定 key 对应的 ring
+func (sc *serviceCache) ringFor(key string) *namespaceRevisionRing {
+	ring, _ := sc.revisionRings.LoadOrStore(key, newNamespaceRevisionRing(sc.revisionRingSize))
+	return ring
+}
+
+// recordRevisionSegments 在一次 setServices 完成并且 reloadRevision 之后，把这次的增量以及
+// 当时生效的最新 revision 写入各命名空间(以及全量)的 ring，供 ListServicesSince 增量读取
+func (sc *serviceCache) recordRevisionSegments(byNs map[string]*revisionDelta) {
+	globalChanged := make([]string, 0, 32)
+	globalRemoved := make([]string, 0, 32)
+
+	for ns, delta := range byNs {
+		revision, _ := sc.ListServices(ns)
+		sc.ringFor(ns).append(&revisionSegment{
+			revision:   revision,
+			changedIDs: delta.changed,
+			removedIDs: delta.removed,
+		})
+		globalChanged = append(globalChanged, delta.changed...)
+		globalRemoved = append(globalRemoved, delta.removed...)
+	}
+
+	if len(globalChanged) == 0 && len(globalRemoved) == 0 {
+		return
+	}
+	globalRevision, _ := sc.ListAllServices()
+	sc.ringFor(allNamespacesRingKey).append(&revisionSegment{
+		revision:   globalRevision,
+		changedIDs: globalChanged,
+		removedIDs: globalRemoved,
+	})
+}
+
+// ListServicesSince 返回 ns（空字符串表示全部命名空间）自 sinceRevision 之后的增量变更。
+// 当 sinceRevision 仍然在 ring 的保留范围内时返回增量的 changed/removed；否则 resyncRequired
+// 为 true，调用方需要退化为 ListServices/ListAllServices 取全量快照。
+func (sc *serviceCache) ListServicesSince(ns string, sinceRevision string) (
+	newRevision string, changed []*model.Service, removed []string, resyncRequired bool, err error) {
+	ringKey := ns
+	if ns == "" {
+		ringKey = allNamespacesRingKey
+	}
+
+	ring, ok := sc.revisionRings.Load(ringKey)
+	if !ok || sinceRevision == "" {
+		newRevision, changed = sc.currentSnapshot(ns)
+		return newRevision, changed, nil, true, nil
+	}
+
+	changedIDs, removedIDs, found := ring.since(sinceRevision)
+	if !found {
+		newRevision, changed = sc.currentSnapshot(ns)
+		return newRevision, changed, nil, true, nil
+	}
+
+	newRevision, _ = sc.currentSnapshot(ns)
+	changed = make([]*model.Service, 0, len(changedIDs))
+	for _, id := range changedIDs {
+		if svc, ok := sc.ids.Load(id); ok {
+			changed = append(changed, svc)
+		}
+	}
+	return newRevision, changed, removedIDs, false, nil
+}
+
+// currentSnapshot 返回 ns（空表示全部命名空间）当前的 revision 与全量服务列表
+func (sc *serviceCache) currentSnapshot(ns string) (string, []*model.Service) {
+	if ns == "" {
+		return sc.ListAllServices()
+	}
+	return sc.ListServices(ns)
+}
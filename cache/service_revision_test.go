@@ -0,0 +1,70 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cache
+
+import "testing"
+
+// TestNamespaceRevisionRingSinceBoundary exercises the since() boundary behavior:
+// a changed-then-removed id must only surface as removed, and once a revision ages
+// out of the ring it must report resyncRequired (found=false) rather than a partial
+// or wrong diff.
+func TestNamespaceRevisionRingSinceBoundary(t *testing.T) {
+	ring := newNamespaceRevisionRing(3)
+	ring.append(&revisionSegment{revision: "r1", changedIDs: []string{"s1"}})
+	ring.append(&revisionSegment{revision: "r2", changedIDs: []string{"s2", "s1"}})
+	ring.append(&revisionSegment{revision: "r3", removedIDs: []string{"s1"}})
+
+	changed, removed, found := ring.since("r1")
+	if !found {
+		t.Fatalf("expected r1 to still be within the ring")
+	}
+	if containsStr(changed, "s1") {
+		t.Errorf("s1 was deleted after r1, it should not appear in changed: %v", changed)
+	}
+	if !containsStr(removed, "s1") {
+		t.Errorf("expected s1 in removed, got %v", removed)
+	}
+	if !containsStr(changed, "s2") {
+		t.Errorf("expected s2 in changed, got %v", changed)
+	}
+
+	// size is 3: appending a 4th segment must evict r1.
+	ring.append(&revisionSegment{revision: "r4", changedIDs: []string{"s3"}})
+	if _, _, found := ring.since("r1"); found {
+		t.Errorf("expected r1 to have aged out of the ring after wraparound")
+	}
+
+	// the most recently appended revision must still be queryable with an empty diff.
+	changed, removed, found = ring.since("r4")
+	if !found {
+		t.Fatalf("expected r4, the most recent segment, to still be found")
+	}
+	if len(changed) != 0 || len(removed) != 0 {
+		t.Errorf("since the latest revision should report zero diff, got changed=%v removed=%v", changed, removed)
+	}
+}
+
+// TestNamespaceRevisionRingUnknownRevision covers the resync fallback for a caller
+// presenting a revision the ring never held (e.g. from a different process/restart).
+func TestNamespaceRevisionRingUnknownRevision(t *testing.T) {
+	ring := newNamespaceRevisionRing(2)
+	ring.append(&revisionSegment{revision: "r1"})
+	if _, _, found := ring.since("does-not-exist"); found {
+		t.Errorf("expected an unknown revision to report not found")
+	}
+}
@@ -0,0 +1,280 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cache
+
+import (
+	"github.com/polarismesh/polaris/common/model"
+	"github.com/polarismesh/polaris/common/utils"
+)
+
+// MetaSelectorOperator 元数据匹配表达式的操作符，参照 Kubernetes label selector 的语义
+type MetaSelectorOperator int
+
+const (
+	// MetaOpIn key 存在且取值在 Values 中
+	MetaOpIn MetaSelectorOperator = iota
+	// MetaOpNotIn key 不存在，或者取值不在 Values 中
+	MetaOpNotIn
+	// MetaOpExists key 存在，不关心取值
+	MetaOpExists
+	// MetaOpDoesNotExist key 不存在
+	MetaOpDoesNotExist
+)
+
+// MetaExpr 一条元数据匹配表达式
+type MetaExpr struct {
+	Key      string
+	Operator MetaSelectorOperator
+	Values   []string
+}
+
+// MetaSelector 服务元数据选择器，MatchLabels 是 MatchExpressions 里 In 操作符的简写形式
+type MetaSelector struct {
+	MatchLabels      map[string]string
+	MatchExpressions []MetaExpr
+}
+
+// matches 判断给定的元数据是否同时满足 MatchLabels 与 MatchExpressions
+func (s MetaSelector) matches(meta map[string]string) bool {
+	for k, v := range s.MatchLabels {
+		if meta[k] != v {
+			return false
+		}
+	}
+	for _, expr := range s.MatchExpressions {
+		val, ok := meta[expr.Key]
+		switch expr.Operator {
+		case MetaOpIn:
+			if !ok || !containsStr(expr.Values, val) {
+				return false
+			}
+		case MetaOpNotIn:
+			if ok && containsStr(expr.Values, val) {
+				return false
+			}
+		case MetaOpExists:
+			if !ok {
+				return false
+			}
+		case MetaOpDoesNotExist:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsStr(list []string, target string) bool {
+	for _, v := range list {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectOpts SelectServices 查询参数
+type SelectOpts struct {
+	// Namespaces 限定查询的命名空间范围，为空表示所有命名空间
+	Namespaces []string
+	// Limit 返回结果数量上限，0 表示不限制
+	Limit int
+}
+
+// serviceMetaIndex 元数据倒排索引：metaKey -> metaValue -> serviceID 集合，
+// 只针对 initialize 时通过 opt["indexedMetaKeys"] 声明的 key 建立，其余 key 走线性扫描兜底
+type serviceMetaIndex struct {
+	indexedKeys map[string]struct{}
+	index       *utils.SyncMap[string, *utils.SyncMap[string, *utils.SyncMap[string, struct{}]]]
+}
+
+// newServiceMetaIndex 根据声明的 indexedMetaKeys 构建索引管理器
+func newServiceMetaIndex(indexedMetaKeys []string) *serviceMetaIndex {
+	keys := make(map[string]struct{}, len(indexedMetaKeys))
+	for _, k := range indexedMetaKeys {
+		keys[k] = struct{}{}
+	}
+	return &serviceMetaIndex{
+		indexedKeys: keys,
+		index:       utils.NewSyncMap[string, *utils.SyncMap[string, *utils.SyncMap[string, struct{}]]](),
+	}
+}
+
+// isIndexed 判断该 meta key 是否已经建立索引
+func (idx *serviceMetaIndex) isIndexed(key string) bool {
+	_, ok := idx.indexedKeys[key]
+	return ok
+}
+
+// reset 清空索引数据，保留 indexedMetaKeys 的配置，供 serviceCache.clear() 在全量重建缓存时使用
+func (idx *serviceMetaIndex) reset() {
+	idx.index = utils.NewSyncMap[string, *utils.SyncMap[string, *utils.SyncMap[string, struct{}]]]()
+}
+
+func (idx *serviceMetaIndex) add(key, value, serviceID string) {
+	valueMap, _ := idx.index.LoadOrStore(key, utils.NewSyncMap[string, *utils.SyncMap[string, struct{}]]())
+	idSet, _ := valueMap.LoadOrStore(value, utils.NewSyncMap[string, struct{}]())
+	idSet.Store(serviceID, struct{}{})
+}
+
+func (idx *serviceMetaIndex) remove(key, value, serviceID string) {
+	valueMap, ok := idx.index.Load(key)
+	if !ok {
+		return
+	}
+	idSet, ok := valueMap.Load(value)
+	if !ok {
+		return
+	}
+	idSet.Delete(serviceID)
+}
+
+// lookup 返回索引中 key=value 命中的服务ID集合，未建立索引或没有命中时返回空集合
+func (idx *serviceMetaIndex) lookup(key, value string) map[string]struct{} {
+	ret := make(map[string]struct{})
+	valueMap, ok := idx.index.Load(key)
+	if !ok {
+		return ret
+	}
+	idSet, ok := valueMap.Load(value)
+	if !ok {
+		return ret
+	}
+	idSet.Range(func(id string, _ struct{}) bool {
+		ret[id] = struct{}{}
+		return true
+	})
+	return ret
+}
+
+// update 根据服务在本次更新前后的元数据差异，增量维护索引
+func (idx *serviceMetaIndex) update(prev, cur *model.Service) {
+	for key := range idx.indexedKeys {
+		var oldVal string
+		var oldOk bool
+		if prev != nil {
+			oldVal, oldOk = prev.Meta[key]
+		}
+		newVal, newOk := cur.Meta[key]
+		if oldOk && (!newOk || oldVal != newVal) {
+			idx.remove(key, oldVal, cur.ID)
+		}
+		if newOk {
+			idx.add(key, newVal, cur.ID)
+		}
+	}
+}
+
+// removeService 从索引中清除一个服务的全部索引条目，在服务被删除时调用
+func (idx *serviceMetaIndex) removeService(svc *model.Service) {
+	for key := range idx.indexedKeys {
+		if val, ok := svc.Meta[key]; ok {
+			idx.remove(key, val, svc.ID)
+		}
+	}
+}
+
+// selectCandidateIDs 尝试用索引收窄候选集合；返回 nil 表示没有可用的索引条件，需要走全量扫描
+func (idx *serviceMetaIndex) selectCandidateIDs(sel MetaSelector) map[string]struct{} {
+	var candidate map[string]struct{}
+	used := false
+
+	intersect := func(ids map[string]struct{}) {
+		if candidate == nil {
+			candidate = ids
+			return
+		}
+		for id := range candidate {
+			if _, ok := ids[id]; !ok {
+				delete(candidate, id)
+			}
+		}
+	}
+
+	for k, v := range sel.MatchLabels {
+		if !idx.isIndexed(k) {
+			continue
+		}
+		intersect(idx.lookup(k, v))
+		used = true
+	}
+	for _, expr := range sel.MatchExpressions {
+		if expr.Operator != MetaOpIn || len(expr.Values) == 0 || !idx.isIndexed(expr.Key) {
+			continue
+		}
+		union := make(map[string]struct{})
+		for _, v := range expr.Values {
+			for id := range idx.lookup(expr.Key, v) {
+				union[id] = struct{}{}
+			}
+		}
+		intersect(union)
+		used = true
+	}
+
+	if !used {
+		return nil
+	}
+	return candidate
+}
+
+// SelectServices 按照 MetaSelector 查询服务，优先使用 indexedMetaKeys 声明的倒排索引收窄
+// 候选集合，未命中索引条件的 key 退化为对候选集合(或全量)的线性扫描
+func (sc *serviceCache) SelectServices(sel MetaSelector, opts SelectOpts) []*model.Service {
+	var nsFilter map[string]struct{}
+	if len(opts.Namespaces) > 0 {
+		nsFilter = make(map[string]struct{}, len(opts.Namespaces))
+		for _, ns := range opts.Namespaces {
+			nsFilter[ns] = struct{}{}
+		}
+	}
+
+	ret := make([]*model.Service, 0, 32)
+	appendIfMatch := func(svc *model.Service) bool {
+		if nsFilter != nil {
+			if _, ok := nsFilter[svc.Namespace]; !ok {
+				return true
+			}
+		}
+		if !sel.matches(svc.Meta) {
+			return true
+		}
+		ret = append(ret, svc)
+		return opts.Limit <= 0 || len(ret) < opts.Limit
+	}
+
+	candidateIDs := sc.metaIndex.selectCandidateIDs(sel)
+	if candidateIDs != nil {
+		for id := range candidateIDs {
+			svc, ok := sc.ids.Load(id)
+			if !ok {
+				continue
+			}
+			if !appendIfMatch(svc) {
+				break
+			}
+		}
+		return ret
+	}
+
+	sc.ids.Range(func(_ string, svc *model.Service) bool {
+		return appendIfMatch(svc)
+	})
+	return ret
+}
@@ -0,0 +1,101 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/polarismesh/polaris/common/model"
+)
+
+// TestServiceMetaIndexUpdateAndSelect covers the same update(nil, svc) call that
+// hydrateFromSnapshot uses to backfill the index on cold start, plus churn via
+// update/removeService, to make sure the index never drifts from sc.ids.
+func TestServiceMetaIndexUpdateAndSelect(t *testing.T) {
+	idx := newServiceMetaIndex([]string{"env", "tier"})
+
+	svcA := &model.Service{ID: "a", Meta: map[string]string{"env": "prod", "tier": "web"}}
+	svcB := &model.Service{ID: "b", Meta: map[string]string{"env": "prod", "tier": "api"}}
+	// hydrateFromSnapshot has no "previous" version to diff against, so it always
+	// calls update(nil, svc) for every service it restores from disk.
+	idx.update(nil, svcA)
+	idx.update(nil, svcB)
+
+	candidates := idx.selectCandidateIDs(MetaSelector{MatchLabels: map[string]string{"env": "prod"}})
+	if candidates == nil {
+		t.Fatalf("expected an indexed candidate set, got nil (full-scan fallback)")
+	}
+	if _, ok := candidates["a"]; !ok {
+		t.Errorf("expected service a in candidates, got %v", candidates)
+	}
+	if _, ok := candidates["b"]; !ok {
+		t.Errorf("expected service b in candidates, got %v", candidates)
+	}
+
+	// service a moves from tier=web to tier=api: the old bucket must be cleaned up.
+	svcAMoved := &model.Service{ID: "a", Meta: map[string]string{"env": "prod", "tier": "api"}}
+	idx.update(svcA, svcAMoved)
+	webCandidates := idx.selectCandidateIDs(MetaSelector{MatchLabels: map[string]string{"tier": "web"}})
+	if _, ok := webCandidates["a"]; ok {
+		t.Errorf("expected service a to be removed from the tier=web bucket after update, got %v", webCandidates)
+	}
+	apiCandidates := idx.selectCandidateIDs(MetaSelector{MatchLabels: map[string]string{"tier": "api"}})
+	if _, ok := apiCandidates["a"]; !ok {
+		t.Errorf("expected service a in the tier=api bucket after update, got %v", apiCandidates)
+	}
+
+	idx.removeService(svcB)
+	prodCandidates := idx.selectCandidateIDs(MetaSelector{MatchLabels: map[string]string{"env": "prod"}})
+	if _, ok := prodCandidates["b"]; ok {
+		t.Errorf("expected service b removed from index after removeService, got %v", prodCandidates)
+	}
+}
+
+// TestServiceMetaIndexFallbackForUnindexedKey makes sure a selector over a key that
+// was never declared in indexedMetaKeys falls back to a full scan (nil candidate set)
+// instead of reporting an empty-but-"used" candidate set.
+func TestServiceMetaIndexFallbackForUnindexedKey(t *testing.T) {
+	idx := newServiceMetaIndex([]string{"env"})
+	candidates := idx.selectCandidateIDs(MetaSelector{MatchLabels: map[string]string{"region": "us"}})
+	if candidates != nil {
+		t.Errorf("expected nil candidates (full-scan fallback) for a non-indexed key, got %v", candidates)
+	}
+}
+
+func TestMetaSelectorMatches(t *testing.T) {
+	sel := MetaSelector{
+		MatchLabels: map[string]string{"env": "prod"},
+		MatchExpressions: []MetaExpr{
+			{Key: "tier", Operator: MetaOpIn, Values: []string{"web", "api"}},
+			{Key: "canary", Operator: MetaOpDoesNotExist},
+		},
+	}
+
+	if !sel.matches(map[string]string{"env": "prod", "tier": "web"}) {
+		t.Errorf("expected match for env=prod, tier=web, no canary key")
+	}
+	if sel.matches(map[string]string{"env": "staging", "tier": "web"}) {
+		t.Errorf("did not expect match when env differs")
+	}
+	if sel.matches(map[string]string{"env": "prod", "tier": "db"}) {
+		t.Errorf("did not expect match when tier is not in the In list")
+	}
+	if sel.matches(map[string]string{"env": "prod", "tier": "web", "canary": "true"}) {
+		t.Errorf("did not expect match when the DoesNotExist key is present")
+	}
+}
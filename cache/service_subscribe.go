@@ -0,0 +1,278 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/polarismesh/polaris/common/model"
+	"github.com/polarismesh/polaris/common/utils"
+)
+
+// SubscriptionID 订阅标识，由 Subscribe 返回，Unsubscribe 时传回
+type SubscriptionID string
+
+// SubscribeFilterType 订阅过滤器类型
+type SubscribeFilterType int
+
+const (
+	// SubscribeByNamespaceAndName 按照命名空间+服务名订阅
+	SubscribeByNamespaceAndName SubscribeFilterType = iota
+	// SubscribeByNamespace 按照命名空间订阅该命名空间下的所有服务
+	SubscribeByNamespace
+	// SubscribeByID 按照服务ID订阅
+	SubscribeByID
+	// SubscribeByCl5Name 按照cl5Name订阅
+	SubscribeByCl5Name
+	// SubscribeByMeta 按照服务元数据的 key/value 订阅
+	SubscribeByMeta
+	// SubscribeByMetaSelector 按照 MetaSelector（matchLabels + matchExpressions）订阅，
+	// 可以跨命名空间组合多个条件，例如 "env=prod 且 tier in (web,api)"
+	SubscribeByMetaSelector
+)
+
+// SubscribeFilter 订阅过滤条件
+type SubscribeFilter struct {
+	Type SubscribeFilterType
+	// Namespace 命名空间，配合 SubscribeByNamespaceAndName、SubscribeByNamespace 使用
+	Namespace string
+	// Name 服务名，配合 SubscribeByNamespaceAndName 使用
+	Name string
+	// ID 服务ID，配合 SubscribeByID 使用
+	ID string
+	// Cl5Name 配合 SubscribeByCl5Name 使用
+	Cl5Name string
+	// MetaKey/MetaValue 配合 SubscribeByMeta 使用
+	MetaKey   string
+	MetaValue string
+	// MetaSel 配合 SubscribeByMetaSelector 使用
+	MetaSel MetaSelector
+}
+
+// match 判断服务是否命中该订阅条件
+func (f SubscribeFilter) match(svc *model.Service) bool {
+	switch f.Type {
+	case SubscribeByNamespaceAndName:
+		return svc.Namespace == f.Namespace && svc.Name == f.Name
+	case SubscribeByNamespace:
+		return svc.Namespace == f.Namespace
+	case SubscribeByID:
+		return svc.ID == f.ID
+	case SubscribeByCl5Name:
+		cl5Name, ok := svc.Meta["internal-cl5-name"]
+		return ok && genCl5Name(cl5Name) == genCl5Name(f.Cl5Name)
+	case SubscribeByMeta:
+		if svc.Meta == nil {
+			return false
+		}
+		val, ok := svc.Meta[f.MetaKey]
+		return ok && val == f.MetaValue
+	case SubscribeByMetaSelector:
+		return f.MetaSel.matches(svc.Meta)
+	default:
+		return false
+	}
+}
+
+// ServiceEventHandler 订阅服务变更的回调接口，与 NamingClient 的 SubscribeCallback 保持同样的风格
+type ServiceEventHandler interface {
+	// OnServiceAdded 有新服务满足订阅条件
+	OnServiceAdded(svc *model.Service)
+	// OnServiceUpdated 已订阅的服务发生了更新
+	OnServiceUpdated(svc *model.Service)
+	// OnServiceDeleted 已订阅的服务被删除
+	OnServiceDeleted(svc *model.Service)
+	// OnBatchSync 订阅建立时的首次全量快照，保证不会与 update() 的增量事件发生竞争
+	OnBatchSync(svcs []*model.Service)
+}
+
+// serviceEventType 服务事件类型
+type serviceEventType int
+
+const (
+	eventServiceAdded serviceEventType = iota
+	eventServiceUpdated
+	eventServiceDeleted
+	// eventBatchSync 订阅建立时的首次全量快照，走和其它事件一样的队列，保证 handler
+	// 一定先看到这条事件，再看到任何后续的 OnServiceXxx 回调
+	eventBatchSync
+)
+
+// serviceEvent 一次服务变更事件
+type serviceEvent struct {
+	eventType serviceEventType
+	service   *model.Service
+	// services 仅 eventBatchSync 使用
+	services []*model.Service
+}
+
+// defaultSubscriberQueueSize 每个订阅者的事件队列容量，超出后按 drop-oldest 策略丢弃
+const defaultSubscriberQueueSize = 128
+
+// serviceSubscription 单个订阅者的运行时状态
+type serviceSubscription struct {
+	id      SubscriptionID
+	filter  SubscribeFilter
+	handler ServiceEventHandler
+
+	queueLock sync.Mutex
+	queue     []*serviceEvent
+	notifyCh  chan struct{}
+	closeCh   chan struct{}
+	closeOnce sync.Once
+
+	droppedEvents uint64
+}
+
+// push 将事件加入订阅者的队列，队列已满时丢弃最旧的事件
+func (s *serviceSubscription) push(event *serviceEvent) {
+	s.queueLock.Lock()
+	s.enqueueLocked(event)
+	s.queueLock.Unlock()
+	s.notify()
+}
+
+// enqueueLocked 在持有 queueLock 的前提下把事件追加到队列尾部，队列已满时丢弃最旧的事件；
+// 尚未被消费的首次快照事件不会被丢弃，此时丢弃排在它之后的最旧事件。
+// 调用方负责加锁/解锁以及解锁后的 notify()。
+func (s *serviceSubscription) enqueueLocked(event *serviceEvent) {
+	if len(s.queue) >= defaultSubscriberQueueSize {
+		if s.queue[0].eventType == eventBatchSync {
+			s.queue = append(s.queue[:1], s.queue[2:]...)
+		} else {
+			s.queue = s.queue[1:]
+		}
+		atomic.AddUint64(&s.droppedEvents, 1)
+		log.Warnf("[Cache][Service] subscription %s event queue full, drop oldest event", s.id)
+	}
+	s.queue = append(s.queue, event)
+}
+
+// notify 唤醒 run() 的消费 goroutine
+func (s *serviceSubscription) notify() {
+	select {
+	case s.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// run 消费队列并依次回调 handler，单独的 goroutine 运行，避免阻塞 setServices 的更新主流程
+func (s *serviceSubscription) run() {
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-s.notifyCh:
+		}
+
+		for {
+			s.queueLock.Lock()
+			if len(s.queue) == 0 {
+				s.queueLock.Unlock()
+				break
+			}
+			event := s.queue[0]
+			s.queue = s.queue[1:]
+			s.queueLock.Unlock()
+
+			switch event.eventType {
+			case eventServiceAdded:
+				s.handler.OnServiceAdded(event.service)
+			case eventServiceUpdated:
+				s.handler.OnServiceUpdated(event.service)
+			case eventServiceDeleted:
+				s.handler.OnServiceDeleted(event.service)
+			case eventBatchSync:
+				s.handler.OnBatchSync(event.services)
+			}
+		}
+	}
+}
+
+// close 停止订阅者的消费 goroutine
+func (s *serviceSubscription) close() {
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+	})
+}
+
+// DroppedEvents 返回该订阅因队列打满而丢弃的事件数，供监控采集
+func (s *serviceSubscription) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&s.droppedEvents)
+}
+
+// Subscribe 注册一个服务变更订阅。首次快照和后续的 OnServiceXxx 回调都经过同一条按订阅者
+// 串行消费的队列投递，因此 handler 始终先看到一次 OnBatchSync，再看到任何增量事件，且不会
+// 有两个 goroutine 同时调用同一个 handler。
+func (sc *serviceCache) Subscribe(filter SubscribeFilter, handler ServiceEventHandler) (SubscriptionID, error) {
+	if handler == nil {
+		return "", errors.New("service event handler is nil")
+	}
+
+	id := SubscriptionID(utils.NewUUID())
+	sub := &serviceSubscription{
+		id:       id,
+		filter:   filter,
+		handler:  handler,
+		notifyCh: make(chan struct{}, 1),
+		closeCh:  make(chan struct{}),
+	}
+
+	// 在订阅者对其它 goroutine 可见（sc.subscribers.Store）之前就持有它的 queueLock：
+	// 这样即使 Store 之后、我们把快照事件入队之前，有并发的 dispatchServiceEvent 找到了
+	// 这个订阅者，它的 push() 也会阻塞在同一把锁上，只能排在快照事件之后，不会抢到前面，
+	// 也不会被丢弃。
+	sub.queueLock.Lock()
+	sc.subscribers.Store(id, sub)
+
+	snapshot := make([]*model.Service, 0, 32)
+	sc.ids.Range(func(_ string, svc *model.Service) bool {
+		if filter.match(svc) {
+			snapshot = append(snapshot, svc)
+		}
+		return true
+	})
+	sub.enqueueLocked(&serviceEvent{eventType: eventBatchSync, services: snapshot})
+	sub.queueLock.Unlock()
+	sub.notify()
+
+	go sub.run()
+	return id, nil
+}
+
+// Unsubscribe 取消一个已经建立的订阅
+func (sc *serviceCache) Unsubscribe(id SubscriptionID) {
+	sub, ok := sc.subscribers.Load(id)
+	if !ok {
+		return
+	}
+	sc.subscribers.Delete(id)
+	sub.close()
+}
+
+// dispatchServiceEvent 将一次服务变更事件异步分发给所有满足条件的订阅者
+func (sc *serviceCache) dispatchServiceEvent(eventType serviceEventType, svc *model.Service) {
+	sc.subscribers.Range(func(_ SubscriptionID, sub *serviceSubscription) bool {
+		if sub.filter.match(svc) {
+			sub.push(&serviceEvent{eventType: eventType, service: svc})
+		}
+		return true
+	})
+}
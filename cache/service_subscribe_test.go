@@ -0,0 +1,154 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/polarismesh/polaris/common/model"
+)
+
+// recordingHandler 记录每次回调的到达顺序，用于断言 OnBatchSync 先于任何 OnServiceXxx。
+type recordingHandler struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *recordingHandler) OnServiceAdded(svc *model.Service) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, "added:"+svc.ID)
+}
+
+func (h *recordingHandler) OnServiceUpdated(svc *model.Service) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, "updated:"+svc.ID)
+}
+
+func (h *recordingHandler) OnServiceDeleted(svc *model.Service) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, "deleted:"+svc.ID)
+}
+
+func (h *recordingHandler) OnBatchSync(svcs []*model.Service) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, "batchsync")
+}
+
+func (h *recordingHandler) snapshot() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.events...)
+}
+
+// TestServiceSubscriptionBatchSyncOrderedBeforeIncremental pushes a batch of
+// OnServiceXxx events from another goroutine while the batch-sync event is
+// enqueued under the same lock-then-enqueue sequence Subscribe() uses, and
+// asserts the handler observes a single OnBatchSync before any incremental event.
+func TestServiceSubscriptionBatchSyncOrderedBeforeIncremental(t *testing.T) {
+	handler := &recordingHandler{}
+	sub := &serviceSubscription{
+		id:       "sub-1",
+		filter:   SubscribeFilter{Type: SubscribeByNamespace, Namespace: "ns-a"},
+		handler:  handler,
+		notifyCh: make(chan struct{}, 1),
+		closeCh:  make(chan struct{}),
+	}
+
+	// As in Subscribe(), queueLock is held before any other goroutine can push.
+	sub.queueLock.Lock()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			sub.push(&serviceEvent{
+				eventType: eventServiceAdded,
+				service:   &model.Service{ID: "concurrent", Namespace: "ns-a"},
+			})
+		}
+	}()
+
+	sub.enqueueLocked(&serviceEvent{eventType: eventBatchSync, services: nil})
+	sub.queueLock.Unlock()
+	sub.notify()
+	go sub.run()
+
+	wg.Wait()
+	sub.push(&serviceEvent{eventType: eventServiceAdded, service: &model.Service{ID: "final", Namespace: "ns-a"}})
+
+	waitForDrain(t, sub)
+	sub.close()
+
+	events := handler.snapshot()
+	if len(events) == 0 || events[0] != "batchsync" {
+		t.Fatalf("expected the first delivered event to be batchsync, got %v", events)
+	}
+	for _, e := range events[1:] {
+		if e == "batchsync" {
+			t.Errorf("expected exactly one batchsync event, got %v", events)
+		}
+	}
+}
+
+// TestServiceSubscriptionDropOldest covers the bounded-queue drop-oldest policy:
+// pushing past defaultSubscriberQueueSize before the consumer goroutine drains
+// must evict the oldest queued events and record them via DroppedEvents.
+func TestServiceSubscriptionDropOldest(t *testing.T) {
+	sub := &serviceSubscription{
+		id:       "sub-2",
+		handler:  &recordingHandler{},
+		notifyCh: make(chan struct{}, 1),
+		closeCh:  make(chan struct{}),
+	}
+
+	sub.queueLock.Lock()
+	for i := 0; i < defaultSubscriberQueueSize+5; i++ {
+		sub.enqueueLocked(&serviceEvent{eventType: eventServiceAdded, service: &model.Service{ID: "svc"}})
+	}
+	queueLen := len(sub.queue)
+	dropped := sub.DroppedEvents()
+	sub.queueLock.Unlock()
+
+	if queueLen != defaultSubscriberQueueSize {
+		t.Errorf("expected queue to be capped at %d, got %d", defaultSubscriberQueueSize, queueLen)
+	}
+	if dropped != 5 {
+		t.Errorf("expected 5 dropped events, got %d", dropped)
+	}
+}
+
+// waitForDrain blocks until sub's queue is empty or the test times out via t.Fatal.
+func waitForDrain(t *testing.T, sub *serviceSubscription) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		sub.queueLock.Lock()
+		empty := len(sub.queue) == 0
+		sub.queueLock.Unlock()
+		if empty {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("subscription queue did not drain in time")
+}
@@ -0,0 +1,89 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cache
+
+import (
+	"time"
+
+	"github.com/polarismesh/polaris/common/model"
+)
+
+// defaultTombstoneTTL 墓碑条目默认保留时长，需要明显长于 InstanceCache 的数量统计传播窗口
+const defaultTombstoneTTL = 10 * time.Minute
+
+// tombstoneGCInterval 墓碑GC的扫描周期
+const tombstoneGCInterval = time.Minute
+
+// Tombstone 记录一个服务被删除时的快照信息，用于在删除之后一段时间内仍然能够还原命名空间归属
+type Tombstone struct {
+	ServiceID string
+	Namespace string
+	Name      string
+	DeletedAt time.Time
+}
+
+// GetTombstone 查询指定服务ID是否存在墓碑记录，不存在返回nil
+func (sc *serviceCache) GetTombstone(id string) *Tombstone {
+	val, ok := sc.tombstones.Load(id)
+	if !ok {
+		return nil
+	}
+	return val
+}
+
+// ListRecentlyDeleted 返回 since 之后被删除的服务墓碑列表，供下游 watcher/xDS 生成准确的删除事件
+func (sc *serviceCache) ListRecentlyDeleted(since time.Time) []*Tombstone {
+	ret := make([]*Tombstone, 0, 8)
+	sc.tombstones.Range(func(_ string, tomb *Tombstone) bool {
+		if !tomb.DeletedAt.Before(since) {
+			ret = append(ret, tomb)
+		}
+		return true
+	})
+	return ret
+}
+
+// addTombstone 在 removeServices 清理内存索引之前记录一条墓碑，避免与之竞争的 InstanceCache
+// 数量统计重载(pendingServices)因为索引已被清空而把命名空间计数挂错地方
+func (sc *serviceCache) addTombstone(service *model.Service) {
+	sc.tombstones.Store(service.ID, &Tombstone{
+		ServiceID: service.ID,
+		Namespace: service.Namespace,
+		Name:      service.Name,
+		DeletedAt: time.Now(),
+	})
+}
+
+// gcTombstones 周期性清理超过 TTL 的墓碑记录
+func (sc *serviceCache) gcTombstones() {
+	ticker := time.NewTicker(tombstoneGCInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		deadline := time.Now().Add(-sc.tombstoneTTL)
+		expired := make([]string, 0, 8)
+		sc.tombstones.Range(func(id string, tomb *Tombstone) bool {
+			if tomb.DeletedAt.Before(deadline) {
+				expired = append(expired, id)
+			}
+			return true
+		})
+		for _, id := range expired {
+			sc.tombstones.Delete(id)
+		}
+	}
+}
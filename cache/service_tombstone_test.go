@@ -0,0 +1,72 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/polarismesh/polaris/common/model"
+	"github.com/polarismesh/polaris/common/utils"
+)
+
+// newTestServiceCacheForTombstone 构造一个最小可用的 serviceCache，只初始化
+// appendServiceCountChangeNamespace 依赖的字段，不经过完整的 initialize()/存储拉取流程。
+func newTestServiceCacheForTombstone() *serviceCache {
+	return &serviceCache{
+		ids:             utils.NewSyncMap[string, *model.Service](),
+		pendingServices: utils.NewSyncMap[string, struct{}](),
+		tombstones:      utils.NewSyncMap[string, *Tombstone](),
+	}
+}
+
+// TestAppendServiceCountChangeNamespaceCreditsTombstone 覆盖 Case TWO：instanceCache 的数量
+// reload 通知先到达，此时服务已经从 sc.ids 中删除，但墓碑还在保留期内，这次通知应该按照墓碑记录
+// 的命名空间归还，而不是被悄悄丢弃。
+func TestAppendServiceCountChangeNamespaceCreditsTombstone(t *testing.T) {
+	sc := newTestServiceCacheForTombstone()
+
+	svc := &model.Service{ID: "svc-1", Namespace: "ns-a", Name: "test-service"}
+	sc.addTombstone(svc)
+	sc.pendingServices.Store(svc.ID, struct{}{})
+
+	changeNs := sc.appendServiceCountChangeNamespace(map[string]struct{}{})
+
+	if _, ok := changeNs["ns-a"]; !ok {
+		t.Errorf("expected tombstoned service's namespace ns-a to be credited, got %v", changeNs)
+	}
+	if _, ok := sc.pendingServices.Load(svc.ID); ok {
+		t.Errorf("expected pending entry for %s to be drained once credited via tombstone", svc.ID)
+	}
+}
+
+// TestAppendServiceCountChangeNamespaceKeepsUnknownServicePending 覆盖既不在 sc.ids 也没有墓碑
+// 的情况（例如 instanceCache 的 reload 通知先于 serviceCache 首次拉取到达）：这次通知既不能凭空
+// 归还到任何命名空间，也不能被直接丢弃，必须继续留在 pendingServices 里等待服务真正出现。
+func TestAppendServiceCountChangeNamespaceKeepsUnknownServicePending(t *testing.T) {
+	sc := newTestServiceCacheForTombstone()
+	sc.pendingServices.Store("unknown-svc", struct{}{})
+
+	changeNs := sc.appendServiceCountChangeNamespace(map[string]struct{}{})
+
+	if len(changeNs) != 0 {
+		t.Errorf("expected no namespace to be credited for an unknown service, got %v", changeNs)
+	}
+	if _, ok := sc.pendingServices.Load("unknown-svc"); !ok {
+		t.Errorf("expected pending entry for unknown-svc to remain until the service is seen or tombstoned")
+	}
+}